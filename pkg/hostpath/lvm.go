@@ -3,9 +3,11 @@ package hostpath
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -15,15 +17,70 @@ import (
 	fs "k8s.io/kubernetes/pkg/volume/util/fs"
 )
 
+// CommandRunner abstracts running an external command, so the argv
+// building and output parsing in this file can be unit tested without a
+// real lvm2/mount/mkfs installation. realRunner is used in production;
+// tests use a fakeRunner that matches on argv patterns and returns canned
+// output.
+type CommandRunner interface {
+	Run(ctx context.Context, name string, args ...string) (stdout []byte, stderr []byte, err error)
+}
+
+// CommandError reports the exit code of a failed command. realRunner
+// translates *exec.ExitError into this so callers can branch on exit code
+// without depending on os/exec, which a fakeRunner cannot produce.
+type CommandError struct {
+	exitCode int
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("command exited with code %d", e.exitCode)
+}
+
+func (e *CommandError) ExitCode() int {
+	return e.exitCode
+}
+
+// realRunner runs commands via exec.LookPath + exec.CommandContext, rather
+// than hard-coding binary paths like /sbin/lvs.
+type realRunner struct{}
+
+func (realRunner) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error finding %q on PATH: %w", name, err)
+	}
+
+	c := exec.CommandContext(ctx, path, args...)
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+
+	err = c.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		err = &CommandError{exitCode: exitErr.ExitCode()}
+	}
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// commandErrorString formats a failed command and its output for wrapping
+// in an error, mirroring the detail %v on *exec.Cmd used to provide.
+func commandErrorString(name string, args []string, stdout []byte, stderr []byte, err error) error {
+	return fmt.Errorf("error running command [%s %s] (stdout=%q, stderr=%q): %w", name, strings.Join(args, " "), string(stdout), string(stderr), err)
+}
+
 type LVM struct {
 	vg       string
 	thinpool string
+	runner   CommandRunner
 }
 
 func NewLVM(vg string, thinpool string) *LVM {
 	return &LVM{
 		vg:       vg,
 		thinpool: thinpool,
+		runner:   realRunner{},
 	}
 }
 
@@ -42,8 +99,8 @@ type reportLV struct {
 	LogicalVolumeSize string `json:"lv_size"`
 	LogicalVolumeTags string `json:"lv_tags"`
 	// PoolLogicalVolume string `json:"pool_lv"`
-	// Origin            string `json:"origin"`
-	// DataPercent       string `json:"data_percent"`
+	Origin      string `json:"origin"`
+	DataPercent string `json:"data_percent"`
 	// MetadataPercent   string `json:"metadata_percent"`
 	// MovePV            string `json:"move_pv"`
 	// MirrorLog         string `json:"mirror_log"`
@@ -76,6 +133,11 @@ func (r *LVMVolume) VolumeSizeBytes() (int64, error) {
 	return n, nil
 }
 
+// IsSnapshot reports whether this LV is a (thin) snapshot of another LV.
+func (r *reportLV) IsSnapshot() bool {
+	return r.Origin != ""
+}
+
 func (r *reportLV) FindTag(key string) (string, bool) {
 	for _, kv := range strings.Split(r.LogicalVolumeTags, ",") {
 		if strings.HasPrefix(kv, key+"=") {
@@ -86,26 +148,22 @@ func (r *reportLV) FindTag(key string) (string, bool) {
 	return "", false
 }
 
-func runLVSReport(ctx context.Context, volumeName string) (*report, error) {
+func runLVSReport(ctx context.Context, runner CommandRunner, volumeName string) (*report, error) {
 	args := []string{
 		"--reportformat=json",
-		"--options=lv_tags,lv_name,lv_size",
+		"--options=lv_tags,lv_name,lv_size,origin,data_percent",
 		"--units=b",
 	}
 	if volumeName != "" {
 		args = append(args, volumeName)
 	}
-	c := exec.CommandContext(ctx, "/sbin/lvs", args...)
-	var stdout bytes.Buffer
-	c.Stdout = &stdout
-	var stderr bytes.Buffer
-	c.Stderr = &stderr
 
-	if err := c.Run(); err != nil {
+	stdout, stderr, err := runner.Run(ctx, "lvs", args...)
+	if err != nil {
 		isNotFound := false
-		if exitError, ok := err.(*exec.ExitError); ok {
-			exitCode := exitError.ExitCode()
-			if exitCode == 5 && strings.Contains(stderr.String(), "Failed to find logical volume") {
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) {
+			if cmdErr.ExitCode() == 5 && strings.Contains(string(stderr), "Failed to find logical volume") {
 				isNotFound = true
 			}
 		}
@@ -114,23 +172,26 @@ func runLVSReport(ctx context.Context, volumeName string) (*report, error) {
 			isNotFound = false
 		}
 		if !isNotFound {
-			return nil, fmt.Errorf("error running command %v (stdout=%q, stderr=%q): %w", c.Args, stdout.String(), stderr.String(), err)
+			return nil, commandErrorString("lvs", args, stdout, stderr, err)
 		}
+		// lvs prints nothing to stdout when the LV doesn't exist, so there is
+		// no JSON to unmarshal; report it as simply having no LVs.
+		return &report{}, nil
 	}
 
 	r := &reportWrapper{}
-	if err := json.Unmarshal(stdout.Bytes(), r); err != nil {
-		return nil, fmt.Errorf("error parsing output from command %v (stdout=%q, stderr=%q): %w", c.Args, stdout.String(), stderr.String(), err)
+	if err := json.Unmarshal(stdout, r); err != nil {
+		return nil, fmt.Errorf("error parsing output from command [lvs %s] (stdout=%q, stderr=%q): %w", strings.Join(args, " "), string(stdout), string(stderr), err)
 	}
 
 	if len(r.Reports) != 1 {
-		return nil, fmt.Errorf("error parsing output from command %v (stdout=%q, stderr=%q): got %d reports, expected exactly 1", c.Args, stdout.String(), stderr.String(), len(r.Reports))
+		return nil, fmt.Errorf("error parsing output from command [lvs %s] (stdout=%q, stderr=%q): got %d reports, expected exactly 1", strings.Join(args, " "), string(stdout), string(stderr), len(r.Reports))
 	}
 	return &r.Reports[0], nil
 }
 
 func (l *LVM) findVolumeByLVName(ctx context.Context, lvName string) (*LVMVolume, error) {
-	info, err := findLVInfo(ctx, l.vg, lvName)
+	info, err := findLVInfo(ctx, l.runner, l.vg, lvName)
 	if err != nil {
 		return nil, err
 	}
@@ -139,12 +200,19 @@ func (l *LVM) findVolumeByLVName(ctx context.Context, lvName string) (*LVMVolume
 	}
 	volumePath := "/volumes/" + l.vg + "/" + lvName
 
+	fsDriver, err := filesystemDriverForVolume(info)
+	if err != nil {
+		return nil, err
+	}
+
 	vol := &LVMVolume{
 		volumePath: volumePath,
 		info:       info,
+		fsDriver:   fsDriver,
 	}
 
-	if err := ensureMountLV(ctx, l.vg, vol.info.LogicalVolumeName, volumePath); err != nil {
+	lvPath := fmt.Sprintf("/dev/%s/%s", l.vg, vol.info.LogicalVolumeName)
+	if err := fsDriver.Mount(ctx, l.runner, lvPath, volumePath); err != nil {
 		return nil, err
 	}
 
@@ -154,26 +222,65 @@ func (l *LVM) findVolumeByLVName(ctx context.Context, lvName string) (*LVMVolume
 type LVMVolume struct {
 	volumePath string
 	info       *reportLV
+	fsDriver   FilesystemDriver
 }
 
 func (l *LVMVolume) GetVolumePath() string {
 	return l.volumePath
 }
 
+// SourceVolumeName returns the LV name this volume is a snapshot of, and
+// whether it is a snapshot at all. Because volume IDs and LV names are the
+// same thing in this driver, this doubles as the CSI source volume ID.
+func (l *LVMVolume) SourceVolumeName() (string, bool) {
+	if !l.info.IsSnapshot() {
+		return "", false
+	}
+	return l.info.Origin, true
+}
+
+// CreationTime returns the snapshot's creation time (unix seconds), as
+// recorded in the created= tag by createSnapshot.
+func (l *LVMVolume) CreationTime() (int64, bool) {
+	v, ok := l.info.FindTag("created")
+	if !ok {
+		return 0, false
+	}
+	t, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return t, true
+}
+
+// ReadyToUse reports whether the volume is ready to be used as a CSI
+// snapshot source. lvcreate --snapshot creates thin snapshots
+// synchronously, so by the time we can see the LV it is always ready.
+func (l *LVMVolume) ReadyToUse() bool {
+	return true
+}
+
+// UsedBytes estimates the snapshot's current size on disk from the thin
+// pool's data_percent for this LV.
+func (l *LVMVolume) UsedBytes() (int64, error) {
+	dataPercent, err := strconv.ParseFloat(l.info.DataPercent, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing data_percent %q: %w", l.info.DataPercent, err)
+	}
+	sizeBytes, err := l.VolumeSizeBytes()
+	if err != nil {
+		return 0, err
+	}
+	return int64(float64(sizeBytes) * dataPercent / 100), nil
+}
+
 type FSInfo struct {
 	BytesAvailable int64
 	BytesCapacity  int64
 }
 
 func (l *LVMVolume) GetFSInfo() (*FSInfo, error) {
-	volumePath := l.GetVolumePath()
-	fsInfo := &FSInfo{}
-	var err error
-	fsInfo.BytesAvailable, fsInfo.BytesCapacity, _, _, _, _, err = fs.Info(volumePath)
-	if err != nil {
-		return nil, err
-	}
-	return fsInfo, nil
+	return l.fsDriver.GetFSInfo(l)
 }
 
 func (l *LVM) findVolumeByVolumeID(ctx context.Context, volumeID string) (*LVMVolume, error) {
@@ -183,7 +290,150 @@ func (l *LVM) findVolumeByVolumeID(ctx context.Context, volumeID string) (*LVMVo
 	return l.findVolumeByLVName(ctx, lvName)
 }
 
-func (l *LVM) createThinLV(ctx context.Context, lvName string, size string, tags []string) (*LVMVolume, error) {
+// LVLayout describes the physical layout to request from lvcreate, plumbed
+// from a CSI CreateVolumeRequest's "stripes", "stripesize" and "mirrors"
+// Parameters so a StorageClass can trade capacity for throughput or
+// redundancy. The layout is recorded in LV tags so findVolumeByLVName can
+// report it back in VolumeContext.
+type LVLayout struct {
+	Stripes    int
+	StripeSize string
+	Mirrors    int
+}
+
+// stripeArgs returns the lvcreate striping flags. Striping is a valid
+// layout for both thin and non-thin LVs, so createThinLV and createLV both
+// call this.
+func (layout LVLayout) stripeArgs() []string {
+	var args []string
+	if layout.Stripes > 0 {
+		args = append(args, "--stripes", strconv.Itoa(layout.Stripes))
+		if layout.StripeSize != "" {
+			args = append(args, "--stripesize", layout.StripeSize)
+		}
+	}
+	return args
+}
+
+// mirrorArgs returns the lvcreate mirroring flags. Mirroring only applies
+// to non-thin LVs: redundancy for thin volumes lives at the pool level, and
+// lvcreate rejects --mirrors on a thin virtual LV. Only createLV calls this.
+func (layout LVLayout) mirrorArgs() []string {
+	var args []string
+	if layout.Mirrors > 0 {
+		args = append(args, "--mirrors", strconv.Itoa(layout.Mirrors), "--mirrorlog", "mirrored")
+	}
+	return args
+}
+
+// stripeTags returns the LV tags recording the striping layout, mirroring
+// stripeArgs so findVolumeByLVName can report it back regardless of
+// whether the LV is thin or non-thin.
+func (layout LVLayout) stripeTags() []string {
+	var tags []string
+	if layout.Stripes > 0 {
+		tags = append(tags, fmt.Sprintf("stripes=%d", layout.Stripes))
+		if layout.StripeSize != "" {
+			tags = append(tags, "stripesize="+layout.StripeSize)
+		}
+	}
+	return tags
+}
+
+// mirrorTags returns the LV tags recording the mirroring layout. Only
+// createLV calls this, matching mirrorArgs.
+func (layout LVLayout) mirrorTags() []string {
+	var tags []string
+	if layout.Mirrors > 0 {
+		tags = append(tags, fmt.Sprintf("mirrors=%d", layout.Mirrors))
+	}
+	return tags
+}
+
+// Stripes returns the number of stripes this volume was created with (0 if
+// it is not striped), as recorded in the stripes= tag.
+func (l *LVMVolume) Stripes() int {
+	v, ok := l.info.FindTag("stripes")
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// Mirrors returns the number of mirrors this volume was created with (0 if
+// it is not mirrored), as recorded in the mirrors= tag.
+func (l *LVMVolume) Mirrors() int {
+	v, ok := l.info.FindTag("mirrors")
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// validateLayout checks that a striped layout can be satisfied by the
+// volume group's physical volumes, so a bad StorageClass parameter fails
+// fast with a clear error instead of an opaque lvcreate failure.
+func (l *LVM) validateLayout(ctx context.Context, layout LVLayout) error {
+	if layout.Stripes <= 1 {
+		return nil
+	}
+
+	pvCount, err := l.pvCount(ctx)
+	if err != nil {
+		return fmt.Errorf("error counting physical volumes in %q: %w", l.vg, err)
+	}
+	if layout.Stripes > pvCount {
+		return fmt.Errorf("requested %d stripes but volume group %q only has %d physical volumes", layout.Stripes, l.vg, pvCount)
+	}
+	return nil
+}
+
+type pvsReportWrapper struct {
+	Reports []struct {
+		PhysicalVolumes []struct {
+			VolumeGroupName string `json:"vg_name"`
+		} `json:"pv"`
+	} `json:"report"`
+}
+
+func (l *LVM) pvCount(ctx context.Context) (int, error) {
+	args := []string{"--reportformat=json", "--options=pv_name,vg_name"}
+	stdout, stderr, err := l.runner.Run(ctx, "pvs", args...)
+	if err != nil {
+		return 0, commandErrorString("pvs", args, stdout, stderr, err)
+	}
+
+	r := &pvsReportWrapper{}
+	if err := json.Unmarshal(stdout, r); err != nil {
+		return 0, fmt.Errorf("error parsing output from command [pvs %s] (stdout=%q, stderr=%q): %w", strings.Join(args, " "), string(stdout), string(stderr), err)
+	}
+	if len(r.Reports) != 1 {
+		return 0, fmt.Errorf("error parsing output from command [pvs %s] (stdout=%q, stderr=%q): got %d reports, expected exactly 1", strings.Join(args, " "), string(stdout), string(stderr), len(r.Reports))
+	}
+
+	count := 0
+	for _, pv := range r.Reports[0].PhysicalVolumes {
+		if pv.VolumeGroupName == l.vg {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// createThinLV creates a thin LV and formats it with fsType (one of
+// "ext4", "xfs" or "block"; "" defaults to "ext4"). fsType is chosen from
+// the storage class's "fsType" parameter, or from the CSI VolumeCapability
+// when AccessType_Block is requested, and is recorded in an fs= tag so
+// findVolumeByLVName selects the same FilesystemDriver again on restart.
+func (l *LVM) createThinLV(ctx context.Context, lvName string, size string, fsType string, layout LVLayout, tags []string) (*LVMVolume, error) {
 	// Must precreate thinpool with: lvcreate -L 200G -T pool/thinpool
 	// Can extend with e.g. /sbin/lvextend -L 20G pool/thinpool
 
@@ -201,6 +451,15 @@ func (l *LVM) createThinLV(ctx context.Context, lvName string, size string, tags
 	// 	  [    --errorwhenfull y|n ]
 	// 	  [ COMMON_OPTIONS ]
 
+	if err := l.validateLayout(ctx, layout); err != nil {
+		return nil, err
+	}
+
+	fsDriver, err := filesystemDriverForName(fsType)
+	if err != nil {
+		return nil, err
+	}
+
 	args := []string{
 		"--virtualsize", size,
 		"--thinpool", l.thinpool,
@@ -208,21 +467,69 @@ func (l *LVM) createThinLV(ctx context.Context, lvName string, size string, tags
 		"--thin",
 		"--type", "thin",
 		"--name", lvName,
+		"--addtag", "fs=" + fsDriver.Name(),
+	}
+	args = append(args, layout.stripeArgs()...)
+	for _, tag := range layout.stripeTags() {
+		args = append(args, "--addtag", tag)
 	}
 	for _, tag := range tags {
 		args = append(args, "--addtag", tag)
 	}
-	c := exec.CommandContext(ctx, "/sbin/lvcreate", args...)
-	var stdout bytes.Buffer
-	c.Stdout = &stdout
-	var stderr bytes.Buffer
-	c.Stderr = &stderr
 
-	if err := c.Run(); err != nil {
-		return nil, fmt.Errorf("error running command %v (stdout=%q, stderr=%q): %w", c.Args, stdout.String(), stderr.String(), err)
+	stdout, stderr, err := l.runner.Run(ctx, "lvcreate", args...)
+	if err != nil {
+		return nil, commandErrorString("lvcreate", args, stdout, stderr, err)
+	}
+
+	return l.finishCreateLV(ctx, lvName, fsDriver)
+}
+
+// createLV creates a non-thin LV, striped and/or mirrored per layout, and
+// formats it with fsType. Unlike thin volumes, non-thin volumes allocate
+// their full size from the VG up front, which is what makes mirroring
+// (itself a form of extra allocation) possible.
+func (l *LVM) createLV(ctx context.Context, lvName string, size string, fsType string, layout LVLayout, tags []string) (*LVMVolume, error) {
+	if err := l.validateLayout(ctx, layout); err != nil {
+		return nil, err
 	}
 
-	if err := mkfsExt4(ctx, l.vg, lvName); err != nil {
+	fsDriver, err := filesystemDriverForName(fsType)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"-L", size,
+		"--name", lvName,
+		"--addtag", "fs=" + fsDriver.Name(),
+	}
+	args = append(args, layout.stripeArgs()...)
+	args = append(args, layout.mirrorArgs()...)
+	for _, tag := range layout.stripeTags() {
+		args = append(args, "--addtag", tag)
+	}
+	for _, tag := range layout.mirrorTags() {
+		args = append(args, "--addtag", tag)
+	}
+	for _, tag := range tags {
+		args = append(args, "--addtag", tag)
+	}
+	args = append(args, l.vg)
+
+	stdout, stderr, err := l.runner.Run(ctx, "lvcreate", args...)
+	if err != nil {
+		return nil, commandErrorString("lvcreate", args, stdout, stderr, err)
+	}
+
+	return l.finishCreateLV(ctx, lvName, fsDriver)
+}
+
+// finishCreateLV formats and mounts a just-created LV, the common tail
+// shared by createThinLV and createLV.
+func (l *LVM) finishCreateLV(ctx context.Context, lvName string, fsDriver FilesystemDriver) (*LVMVolume, error) {
+	devicePath := fmt.Sprintf("/dev/%s/%s", l.vg, lvName)
+	if err := fsDriver.Mkfs(ctx, l.runner, devicePath, lvName); err != nil {
 		// TODO: Delete the LV
 		return nil, fmt.Errorf("error formatting volume: %w", err)
 	}
@@ -236,8 +543,253 @@ func (l *LVM) createThinLV(ctx context.Context, lvName string, size string, tags
 	return lv, nil
 }
 
+// expandLV grows the underlying LV to newSize via lvextend, then grows
+// volume's filesystem to match via its FilesystemDriver. This is called by
+// the CSI controller's ControllerExpandVolume and (for filesystems that
+// need to grow with the volume still attached) the node's NodeExpandVolume.
+func (l *LVM) expandLV(ctx context.Context, volume *LVMVolume, newSize string) error {
+	args := []string{"-L", newSize, l.vg + "/" + volume.LogicalVolumeName()}
+	stdout, stderr, err := l.runner.Run(ctx, "lvextend", args...)
+	if err != nil {
+		if strings.Contains(string(stderr), "Insufficient free space") || strings.Contains(string(stderr), "insufficient suitable") {
+			if free, ferr := l.thinPoolFreeSpace(ctx); ferr == nil {
+				return fmt.Errorf("cannot expand volume %q to %s: thin pool %s/%s does not have enough free space (%s): %w", volume.LogicalVolumeName(), newSize, l.vg, l.thinpool, free, err)
+			}
+			return fmt.Errorf("cannot expand volume %q to %s: thin pool %s/%s does not have enough free space: %w", volume.LogicalVolumeName(), newSize, l.vg, l.thinpool, err)
+		}
+		return commandErrorString("lvextend", args, stdout, stderr, err)
+	}
+
+	devicePath := fmt.Sprintf("/dev/%s/%s", l.vg, volume.LogicalVolumeName())
+
+	if err := volume.fsDriver.Expand(ctx, l.runner, devicePath, volume.volumePath); err != nil {
+		return fmt.Errorf("error resizing filesystem on %q: %w", devicePath, err)
+	}
+
+	info, err := findLVInfo(ctx, l.runner, l.vg, volume.LogicalVolumeName())
+	if err != nil {
+		return fmt.Errorf("error refreshing lv info after resize: %w", err)
+	}
+	if info == nil {
+		return fmt.Errorf("lv %q disappeared after resize", volume.LogicalVolumeName())
+	}
+	volume.info = info
+
+	return nil
+}
+
+type thinPoolReportWrapper struct {
+	Reports []struct {
+		LogicalVolumes []struct {
+			LogicalVolumeSize string `json:"lv_size"`
+			DataPercent       string `json:"data_percent"`
+		} `json:"lv"`
+	} `json:"report"`
+}
+
+// thinPoolFreeSpace returns a human-readable summary of the free space in
+// the configured thin pool, so that an expand request that the pool cannot
+// satisfy surfaces a clear, actionable error.
+func (l *LVM) thinPoolFreeSpace(ctx context.Context) (string, error) {
+	args := []string{
+		"--reportformat=json",
+		"--units=b",
+		"--options=lv_size,data_percent",
+		l.vg + "/" + l.thinpool,
+	}
+	stdout, stderr, err := l.runner.Run(ctx, "lvs", args...)
+	if err != nil {
+		return "", commandErrorString("lvs", args, stdout, stderr, err)
+	}
+
+	r := &thinPoolReportWrapper{}
+	if err := json.Unmarshal(stdout, r); err != nil {
+		return "", fmt.Errorf("error parsing output from command [lvs %s] (stdout=%q, stderr=%q): %w", strings.Join(args, " "), string(stdout), string(stderr), err)
+	}
+	if len(r.Reports) != 1 || len(r.Reports[0].LogicalVolumes) != 1 {
+		return "", fmt.Errorf("unexpected output from command [lvs %s] (stdout=%q)", strings.Join(args, " "), string(stdout))
+	}
+
+	pool := r.Reports[0].LogicalVolumes[0]
+	sizeBytes, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSuffix(pool.LogicalVolumeSize, "B"), "b"), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("error parsing pool size %q: %w", pool.LogicalVolumeSize, err)
+	}
+	dataPercent, err := strconv.ParseFloat(pool.DataPercent, 64)
+	if err != nil {
+		return "", fmt.Errorf("error parsing pool data_percent %q: %w", pool.DataPercent, err)
+	}
+
+	freeBytes := int64(float64(sizeBytes) * (100 - dataPercent) / 100)
+	return fmt.Sprintf("%dB free of %dB", freeBytes, sizeBytes), nil
+}
+
+// isMounted reports whether mountPath is currently a mount point.
+func isMounted(ctx context.Context, runner CommandRunner, mountPath string) (bool, error) {
+	_, _, err := runner.Run(ctx, "mountpoint", "-q", mountPath)
+	if err != nil {
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) && cmdErr.ExitCode() == 1 {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// e2fsck runs a forced filesystem check, which resize2fs requires before it
+// can perform an offline resize. Exit codes 1 and 2 indicate errors were
+// found and corrected, which is not itself a failure.
+func e2fsck(ctx context.Context, runner CommandRunner, devicePath string) error {
+	args := []string{"-f", "-y", devicePath}
+	stdout, stderr, err := runner.Run(ctx, "e2fsck", args...)
+	if err != nil {
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) && (cmdErr.ExitCode() == 1 || cmdErr.ExitCode() == 2) {
+			return nil
+		}
+		return commandErrorString("e2fsck", args, stdout, stderr, err)
+	}
+
+	return nil
+}
+
+func resize2fs(ctx context.Context, runner CommandRunner, devicePath string) error {
+	args := []string{devicePath}
+	stdout, stderr, err := runner.Run(ctx, "resize2fs", args...)
+	if err != nil {
+		return commandErrorString("resize2fs", args, stdout, stderr, err)
+	}
+
+	return nil
+}
+
+// createSnapshot creates a thin snapshot of source named snapName, tagged
+// with tags (the caller is expected to include a created=<unix-seconds> tag
+// so CreationTime can report it back). Thin snapshots need no size of their
+// own and are writable and usable as soon as lvcreate returns, which backs
+// the CSI CreateSnapshot RPC.
+func (l *LVM) createSnapshot(ctx context.Context, source *LVMVolume, snapName string, tags []string) (*LVMVolume, error) {
+	args := []string{
+		"--snapshot",
+		"--name", snapName,
+		l.vg + "/" + source.LogicalVolumeName(),
+	}
+	for _, tag := range tags {
+		args = append(args, "--addtag", tag)
+	}
+
+	stdout, stderr, err := l.runner.Run(ctx, "lvcreate", args...)
+	if err != nil {
+		return nil, commandErrorString("lvcreate", args, stdout, stderr, err)
+	}
+
+	info, err := findLVInfo(ctx, l.runner, l.vg, snapName)
+	if err != nil {
+		return nil, fmt.Errorf("error getting lv info for newly created snapshot: %w", err)
+	}
+	if info == nil {
+		return nil, fmt.Errorf("could not find LV info for newly created snapshot %q", snapName)
+	}
+
+	fsDriver, err := filesystemDriverForVolume(info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LVMVolume{
+		volumePath: "/volumes/" + l.vg + "/" + snapName,
+		info:       info,
+		fsDriver:   fsDriver,
+	}, nil
+}
+
+// deleteSnapshot backs the CSI DeleteSnapshot RPC. Unlike deleteLV,
+// snapshots are never mounted in the first place, so there is nothing to
+// unmount before the lvremove.
+func (l *LVM) deleteSnapshot(ctx context.Context, snapshot *LVMVolume) error {
+	args := []string{
+		"--yes",
+		l.vg + "/" + snapshot.LogicalVolumeName(),
+	}
+	stdout, stderr, err := l.runner.Run(ctx, "lvremove", args...)
+	if err != nil {
+		return commandErrorString("lvremove", args, stdout, stderr, err)
+	}
+
+	return nil
+}
+
+// listSnapshots returns the snapshot LVs in the volume group whose origin
+// is sourceLVName, or every snapshot LV if sourceLVName is empty. It backs
+// the CSI ListSnapshots RPC.
+func (l *LVM) listSnapshots(ctx context.Context, sourceLVName string) ([]*LVMVolume, error) {
+	report, err := runLVSReport(ctx, l.runner, l.vg)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []*LVMVolume
+	for i := range report.LogicalVolumes {
+		info := &report.LogicalVolumes[i]
+		if !info.IsSnapshot() {
+			continue
+		}
+		if sourceLVName != "" && info.Origin != sourceLVName {
+			continue
+		}
+
+		fsDriver, err := filesystemDriverForVolume(info)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshots = append(snapshots, &LVMVolume{
+			volumePath: "/volumes/" + l.vg + "/" + info.LogicalVolumeName,
+			info:       info,
+			fsDriver:   fsDriver,
+		})
+	}
+
+	return snapshots, nil
+}
+
+// createVolumeFromSource creates a new volume by taking a thin snapshot of
+// source and mounting it like any other volume. Because thin snapshots are
+// independently writable from the moment they are created, this single
+// path backs both "clone from volume" and "restore from snapshot"
+// CreateVolume requests. The new LV inherits source's filesystem type,
+// since resizing or reformatting a just-cloned volume is not supported.
+func (l *LVM) createVolumeFromSource(ctx context.Context, source *LVMVolume, lvName string, tags []string) (*LVMVolume, error) {
+	fsType, _ := source.info.FindTag("fs")
+
+	args := []string{
+		"--snapshot",
+		"--name", lvName,
+		l.vg + "/" + source.LogicalVolumeName(),
+		"--addtag", "fs=" + fsType,
+	}
+	for _, tag := range tags {
+		args = append(args, "--addtag", tag)
+	}
+
+	stdout, stderr, err := l.runner.Run(ctx, "lvcreate", args...)
+	if err != nil {
+		return nil, commandErrorString("lvcreate", args, stdout, stderr, err)
+	}
+
+	lv, err := l.findVolumeByLVName(ctx, lvName)
+	if err != nil {
+		return nil, fmt.Errorf("error getting lv info for volume cloned from %q: %w", source.LogicalVolumeName(), err)
+	}
+	if lv == nil {
+		return nil, fmt.Errorf("could not find LV info for volume %q cloned from %q", lvName, source.LogicalVolumeName())
+	}
+	return lv, nil
+}
+
 func (l *LVM) deleteLV(ctx context.Context, volume *LVMVolume) error {
-	if err := ensureUnmountLV(ctx, l.vg, volume.info.LogicalVolumeName, volume.volumePath); err != nil {
+	if err := ensureUnmountLV(ctx, l.runner, volume.volumePath); err != nil {
 		return err
 	}
 
@@ -245,21 +797,16 @@ func (l *LVM) deleteLV(ctx context.Context, volume *LVMVolume) error {
 		"--yes",
 		l.vg + "/" + volume.LogicalVolumeName(),
 	}
-	c := exec.CommandContext(ctx, "/sbin/lvremove", args...)
-	var stdout bytes.Buffer
-	c.Stdout = &stdout
-	var stderr bytes.Buffer
-	c.Stderr = &stderr
-
-	if err := c.Run(); err != nil {
-		return fmt.Errorf("error running command %v (stdout=%q, stderr=%q): %w", c.Args, stdout.String(), stderr.String(), err)
+	stdout, stderr, err := l.runner.Run(ctx, "lvremove", args...)
+	if err != nil {
+		return commandErrorString("lvremove", args, stdout, stderr, err)
 	}
 
 	return nil
 }
 
-func findLVInfo(ctx context.Context, vgName string, lvName string) (*reportLV, error) {
-	report, err := runLVSReport(ctx, vgName+"/"+lvName)
+func findLVInfo(ctx context.Context, runner CommandRunner, vgName string, lvName string) (*reportLV, error) {
+	report, err := runLVSReport(ctx, runner, vgName+"/"+lvName)
 	if err != nil {
 		return nil, err
 	}
@@ -272,70 +819,216 @@ func findLVInfo(ctx context.Context, vgName string, lvName string) (*reportLV, e
 	return &report.LogicalVolumes[0], nil
 }
 
-func ensureMountLV(ctx context.Context, vgName string, lvName string, mountPath string) error {
-	lvPath := fmt.Sprintf("/dev/%s/%s", vgName, lvName)
+// runMount runs mount with args, tolerating "already mounted" (exit code
+// 32) since that just means a previous call already did the work.
+func runMount(ctx context.Context, runner CommandRunner, args []string) error {
+	stdout, stderr, err := runner.Run(ctx, "mount", args...)
+	if err != nil {
+		isAlreadyMounted := false
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) && cmdErr.ExitCode() == 32 && strings.Contains(string(stderr), "already mounted on") {
+			isAlreadyMounted = true
+			// TODO: Cache volumes
+			klog.Infof("volume was already mounted (mount %s)", strings.Join(args, " "))
+		}
+
+		if !isAlreadyMounted {
+			return commandErrorString("mount", args, stdout, stderr, err)
+		}
+	}
+
+	return nil
+}
+
+func ensureUnmountLV(ctx context.Context, runner CommandRunner, mountPath string) error {
+	args := []string{mountPath}
+	stdout, stderr, err := runner.Run(ctx, "umount", args...)
+	if err != nil {
+		return commandErrorString("umount", args, stdout, stderr, err)
+	}
+
+	return nil
+}
+
+// FilesystemDriver formats, mounts and grows the block device backing an
+// LV. Its Name() is persisted in the fs= LV tag so findVolumeByLVName can
+// select the same driver again after a restart.
+type FilesystemDriver interface {
+	Name() string
+	Mkfs(ctx context.Context, runner CommandRunner, devicePath string, label string) error
+	Mount(ctx context.Context, runner CommandRunner, devicePath string, mountPath string) error
+	// Expand grows the filesystem on devicePath (mounted at mountPath) to
+	// fill the LV after it has been lvextend'd.
+	Expand(ctx context.Context, runner CommandRunner, devicePath string, mountPath string) error
+	GetFSInfo(volume *LVMVolume) (*FSInfo, error)
+}
+
+var filesystemDrivers = map[string]FilesystemDriver{
+	"ext4":  ext4FilesystemDriver{},
+	"xfs":   xfsFilesystemDriver{},
+	"block": blockFilesystemDriver{},
+}
+
+// filesystemDriverForName looks up a FilesystemDriver by its storage-class
+// / VolumeCapability name, defaulting to ext4 for backwards compatibility.
+func filesystemDriverForName(name string) (FilesystemDriver, error) {
+	if name == "" {
+		name = "ext4"
+	}
+	d, ok := filesystemDrivers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown filesystem type %q", name)
+	}
+	return d, nil
+}
+
+// filesystemDriverForVolume recovers the FilesystemDriver an existing LV
+// was created with from its fs= tag.
+func filesystemDriverForVolume(info *reportLV) (FilesystemDriver, error) {
+	name, _ := info.FindTag("fs")
+	return filesystemDriverForName(name)
+}
+
+// ext4FilesystemDriver formats volumes as ext4. It is the default, and
+// supports online growth via resize2fs.
+type ext4FilesystemDriver struct{}
+
+func (ext4FilesystemDriver) Name() string { return "ext4" }
+
+func (ext4FilesystemDriver) Mkfs(ctx context.Context, runner CommandRunner, devicePath string, label string) error {
+	args := []string{"-L", label, devicePath}
+	stdout, stderr, err := runner.Run(ctx, "mkfs.ext4", args...)
+	if err != nil {
+		return commandErrorString("mkfs.ext4", args, stdout, stderr, err)
+	}
+
+	return nil
+}
 
+func (ext4FilesystemDriver) Mount(ctx context.Context, runner CommandRunner, devicePath string, mountPath string) error {
 	if err := os.MkdirAll(mountPath, 0777); err != nil {
 		return fmt.Errorf("error creating mount directory %q: %w", mountPath, err)
 	}
 
 	// --make-shared is required that this mount is visible outside this container.
-	args := []string{"--make-shared", "-t", "ext4", lvPath, mountPath}
-	c := exec.CommandContext(ctx, "/bin/mount", args...)
-	var stdout bytes.Buffer
-	c.Stdout = &stdout
-	var stderr bytes.Buffer
-	c.Stderr = &stderr
+	return runMount(ctx, runner, []string{"--make-shared", "-t", "ext4", devicePath, mountPath})
+}
 
-	if err := c.Run(); err != nil {
-		isAlreadyMounted := false
-		if exitError, ok := err.(*exec.ExitError); ok {
-			exitCode := exitError.ExitCode()
-			if exitCode == 32 && strings.Contains(stderr.String(), "already mounted on") {
-				isAlreadyMounted = true
-				// TODO: Cache volumes
-				klog.Infof("volume %q was already mounted", mountPath)
-			}
-		}
+func (ext4FilesystemDriver) Expand(ctx context.Context, runner CommandRunner, devicePath string, mountPath string) error {
+	mounted, err := isMounted(ctx, runner, mountPath)
+	if err != nil {
+		return fmt.Errorf("error checking mount status of %q: %w", mountPath, err)
+	}
 
-		if !isAlreadyMounted {
-			return fmt.Errorf("error running command %v (stdout=%q, stderr=%q): %w", c.Args, stdout.String(), stderr.String(), err)
+	// resize2fs requires a clean filesystem to do an offline resize; if the
+	// filesystem is mounted it can instead resize online.
+	if !mounted {
+		if err := e2fsck(ctx, runner, devicePath); err != nil {
+			return fmt.Errorf("error checking filesystem before offline resize: %w", err)
 		}
 	}
 
+	return resize2fs(ctx, runner, devicePath)
+}
+
+func (ext4FilesystemDriver) GetFSInfo(volume *LVMVolume) (*FSInfo, error) {
+	fsInfo := &FSInfo{}
+	var err error
+	fsInfo.BytesAvailable, fsInfo.BytesCapacity, _, _, _, _, err = fs.Info(volume.volumePath)
+	if err != nil {
+		return nil, err
+	}
+	return fsInfo, nil
+}
+
+// xfsFilesystemDriver formats volumes as xfs with reflink support, which
+// thin snapshots of xfs volumes rely on. XFS can only grow online, via
+// xfs_growfs against the mount point.
+type xfsFilesystemDriver struct{}
+
+func (xfsFilesystemDriver) Name() string { return "xfs" }
+
+func (xfsFilesystemDriver) Mkfs(ctx context.Context, runner CommandRunner, devicePath string, label string) error {
+	args := []string{"-L", label, "-m", "reflink=1", devicePath}
+	stdout, stderr, err := runner.Run(ctx, "mkfs.xfs", args...)
+	if err != nil {
+		return commandErrorString("mkfs.xfs", args, stdout, stderr, err)
+	}
+
 	return nil
 }
 
-func ensureUnmountLV(ctx context.Context, vgName string, lvName string, mountPath string) error {
-	args := []string{mountPath}
-	c := exec.CommandContext(ctx, "/bin/umount", args...)
-	var stdout bytes.Buffer
-	c.Stdout = &stdout
-	var stderr bytes.Buffer
-	c.Stderr = &stderr
+func (xfsFilesystemDriver) Mount(ctx context.Context, runner CommandRunner, devicePath string, mountPath string) error {
+	if err := os.MkdirAll(mountPath, 0777); err != nil {
+		return fmt.Errorf("error creating mount directory %q: %w", mountPath, err)
+	}
 
-	if err := c.Run(); err != nil {
-		return fmt.Errorf("error running command %v (stdout=%q, stderr=%q): %w", c.Args, stdout.String(), stderr.String(), err)
+	return runMount(ctx, runner, []string{"--make-shared", "-t", "xfs", devicePath, mountPath})
+}
+
+func (xfsFilesystemDriver) Expand(ctx context.Context, runner CommandRunner, devicePath string, mountPath string) error {
+	mounted, err := isMounted(ctx, runner, mountPath)
+	if err != nil {
+		return fmt.Errorf("error checking mount status of %q: %w", mountPath, err)
+	}
+	if !mounted {
+		return fmt.Errorf("cannot grow xfs filesystem on %q: xfs_growfs requires the filesystem to be mounted", devicePath)
+	}
+
+	args := []string{mountPath}
+	stdout, stderr, err := runner.Run(ctx, "xfs_growfs", args...)
+	if err != nil {
+		return commandErrorString("xfs_growfs", args, stdout, stderr, err)
 	}
 
 	return nil
 }
 
-func mkfsExt4(ctx context.Context, vgName string, lvName string) error {
-	devicePath := fmt.Sprintf("/dev/%s/%s", vgName, lvName)
+func (xfsFilesystemDriver) GetFSInfo(volume *LVMVolume) (*FSInfo, error) {
+	fsInfo := &FSInfo{}
+	var err error
+	fsInfo.BytesAvailable, fsInfo.BytesCapacity, _, _, _, _, err = fs.Info(volume.volumePath)
+	if err != nil {
+		return nil, err
+	}
+	return fsInfo, nil
+}
 
-	label := lvName
+// blockFilesystemDriver backs CSI block-mode volumes: no filesystem is
+// created, and the LV's device node is exposed directly via a bind-mount
+// of the device onto a (file) mountPath.
+type blockFilesystemDriver struct{}
 
-	args := []string{"-L", label, devicePath}
-	c := exec.CommandContext(ctx, "/sbin/mkfs.ext4", args...)
-	var stdout bytes.Buffer
-	c.Stdout = &stdout
-	var stderr bytes.Buffer
-	c.Stderr = &stderr
+func (blockFilesystemDriver) Name() string { return "block" }
+
+func (blockFilesystemDriver) Mkfs(ctx context.Context, runner CommandRunner, devicePath string, label string) error {
+	return nil
+}
+
+func (blockFilesystemDriver) Mount(ctx context.Context, runner CommandRunner, devicePath string, mountPath string) error {
+	if err := os.MkdirAll(filepath.Dir(mountPath), 0777); err != nil {
+		return fmt.Errorf("error creating parent directory of %q: %w", mountPath, err)
+	}
 
-	if err := c.Run(); err != nil {
-		return fmt.Errorf("error running command %v (stdout=%q, stderr=%q): %w", c.Args, stdout.String(), stderr.String(), err)
+	f, err := os.OpenFile(mountPath, os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("error creating bind-mount target %q: %w", mountPath, err)
 	}
+	f.Close()
+
+	return runMount(ctx, runner, []string{"--make-shared", "--bind", devicePath, mountPath})
+}
 
+func (blockFilesystemDriver) Expand(ctx context.Context, runner CommandRunner, devicePath string, mountPath string) error {
+	// The LV itself was already grown by lvextend; the block device it
+	// exposes reflects the new size with nothing further to do.
 	return nil
 }
+
+func (blockFilesystemDriver) GetFSInfo(volume *LVMVolume) (*FSInfo, error) {
+	size, err := volume.VolumeSizeBytes()
+	if err != nil {
+		return nil, err
+	}
+	return &FSInfo{BytesAvailable: size, BytesCapacity: size}, nil
+}
@@ -0,0 +1,155 @@
+package hostpath
+
+import (
+	"context"
+	"testing"
+)
+
+// newTestLVMVolume builds an LVMVolume backed by the ext4 driver, as if it
+// had just been returned by findVolumeByLVName.
+func newTestLVMVolume(lvName string, sizeBytes string) *LVMVolume {
+	return &LVMVolume{
+		volumePath: "/volumes/myvg/" + lvName,
+		info: &reportLV{
+			LogicalVolumeName: lvName,
+			LogicalVolumeSize: sizeBytes,
+			LogicalVolumeTags: "fs=ext4",
+		},
+		fsDriver: ext4FilesystemDriver{},
+	}
+}
+
+func TestExpandLVGrowsUnmountedFilesystem(t *testing.T) {
+	volume := newTestLVMVolume("data-1", "1073741824B")
+
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{name: "lvextend", argsHas: []string{"-L", "2Gi", "myvg/data-1"}},
+			{name: "mountpoint", argsHas: []string{"/volumes/myvg/data-1"}, exitCode: 1},
+			{name: "e2fsck", argsHas: []string{"/dev/myvg/data-1"}},
+			{name: "resize2fs", argsHas: []string{"/dev/myvg/data-1"}},
+			{
+				name:    "lvs",
+				argsHas: []string{"myvg/data-1"},
+				stdout:  `{"report":[{"lv":[{"lv_name":"data-1","lv_size":"2147483648B","lv_tags":"fs=ext4","origin":"","data_percent":""}]}]}`,
+			},
+		},
+	}
+	l := &LVM{vg: "myvg", thinpool: "pool", runner: runner}
+
+	if err := l.expandLV(context.Background(), volume, "2Gi"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	size, err := volume.VolumeSizeBytes()
+	if err != nil {
+		t.Fatalf("unexpected error reading resized volume size: %v", err)
+	}
+	if size != 2147483648 {
+		t.Errorf("expected volume.info to be refreshed to the new size, got %d bytes", size)
+	}
+}
+
+func TestExpandLVGrowsMountedFilesystemWithoutFsck(t *testing.T) {
+	volume := newTestLVMVolume("data-1", "1073741824B")
+
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{name: "lvextend", argsHas: []string{"-L", "2Gi", "myvg/data-1"}},
+			{name: "mountpoint", argsHas: []string{"/volumes/myvg/data-1"}},
+			// no e2fsck call registered: it must not be run while mounted
+			{name: "resize2fs", argsHas: []string{"/dev/myvg/data-1"}},
+			{
+				name:    "lvs",
+				argsHas: []string{"myvg/data-1"},
+				stdout:  `{"report":[{"lv":[{"lv_name":"data-1","lv_size":"2147483648B","lv_tags":"fs=ext4","origin":"","data_percent":""}]}]}`,
+			},
+		},
+	}
+	l := &LVM{vg: "myvg", thinpool: "pool", runner: runner}
+
+	if err := l.expandLV(context.Background(), volume, "2Gi"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestExpandLVInsufficientThinPoolSpace(t *testing.T) {
+	volume := newTestLVMVolume("data-1", "1073741824B")
+
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{
+				name:     "lvextend",
+				argsHas:  []string{"-L", "1000Gi", "myvg/data-1"},
+				stderr:   "  Insufficient free space: 900 extents needed, but only 10 available\n",
+				exitCode: 5,
+			},
+			{
+				name:    "lvs",
+				argsHas: []string{"myvg/pool"},
+				stdout:  `{"report":[{"lv":[{"lv_size":"10737418240B","data_percent":"90"}]}]}`,
+			},
+		},
+	}
+	l := &LVM{vg: "myvg", thinpool: "pool", runner: runner}
+
+	err := l.expandLV(context.Background(), volume, "1000Gi")
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+}
+
+func TestThinPoolFreeSpace(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{
+				name:    "lvs",
+				argsHas: []string{"myvg/pool"},
+				stdout:  `{"report":[{"lv":[{"lv_size":"10000000000B","data_percent":"75"}]}]}`,
+			},
+		},
+	}
+	l := &LVM{vg: "myvg", thinpool: "pool", runner: runner}
+
+	free, err := l.thinPoolFreeSpace(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if free != "2500000000B free of 10000000000B" {
+		t.Errorf("unexpected free space summary: %q", free)
+	}
+}
+
+func TestExt4FilesystemDriverExpandUnmountedRunsFsck(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{name: "mountpoint", argsHas: []string{"/volumes/myvg/data-1"}, exitCode: 1},
+			{name: "e2fsck", argsHas: []string{"-f", "-y", "/dev/myvg/data-1"}, exitCode: 1},
+			{name: "resize2fs", argsHas: []string{"/dev/myvg/data-1"}},
+		},
+	}
+
+	d := ext4FilesystemDriver{}
+	if err := d.Expand(context.Background(), runner, "/dev/myvg/data-1", "/volumes/myvg/data-1"); err != nil {
+		t.Fatalf("expected e2fsck exit code 1 (errors corrected) to be tolerated, got: %v", err)
+	}
+}
+
+func TestXfsFilesystemDriverExpandRequiresMount(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{name: "mountpoint", argsHas: []string{"/volumes/myvg/data-1"}, exitCode: 1},
+		},
+	}
+
+	d := xfsFilesystemDriver{}
+	if err := d.Expand(context.Background(), runner, "/dev/myvg/data-1", "/volumes/myvg/data-1"); err == nil {
+		t.Fatalf("expected error when xfs volume is not mounted, got nil")
+	}
+}
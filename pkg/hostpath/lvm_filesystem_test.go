@@ -0,0 +1,141 @@
+package hostpath
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestExt4FilesystemDriverMkfs(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{name: "mkfs.ext4", argsHas: []string{"-L", "data-1", "/dev/myvg/data-1"}},
+		},
+	}
+
+	d := ext4FilesystemDriver{}
+	if err := d.Mkfs(context.Background(), runner, "/dev/myvg/data-1", "data-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestExt4FilesystemDriverMount(t *testing.T) {
+	mountPath := filepath.Join(t.TempDir(), "volumes", "myvg", "data-1")
+
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{name: "mount", argsHas: []string{"--make-shared", "-t", "ext4", "/dev/myvg/data-1", mountPath}},
+		},
+	}
+
+	d := ext4FilesystemDriver{}
+	if err := d.Mount(context.Background(), runner, "/dev/myvg/data-1", mountPath); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestXfsFilesystemDriverMkfsUsesReflink(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{name: "mkfs.xfs", argsHas: []string{"-L", "data-1", "-m", "reflink=1", "/dev/myvg/data-1"}},
+		},
+	}
+
+	d := xfsFilesystemDriver{}
+	if err := d.Mkfs(context.Background(), runner, "/dev/myvg/data-1", "data-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestXfsFilesystemDriverMount(t *testing.T) {
+	mountPath := filepath.Join(t.TempDir(), "volumes", "myvg", "data-1")
+
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{name: "mount", argsHas: []string{"--make-shared", "-t", "xfs", "/dev/myvg/data-1", mountPath}},
+		},
+	}
+
+	d := xfsFilesystemDriver{}
+	if err := d.Mount(context.Background(), runner, "/dev/myvg/data-1", mountPath); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBlockFilesystemDriverMkfsIsNoOp(t *testing.T) {
+	runner := &fakeRunner{t: t} // no calls registered: Mkfs must not run anything
+	d := blockFilesystemDriver{}
+	if err := d.Mkfs(context.Background(), runner, "/dev/myvg/data-1", "data-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBlockFilesystemDriverMountBindsDevice(t *testing.T) {
+	mountPath := filepath.Join(t.TempDir(), "volumes", "myvg", "data-1")
+
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{name: "mount", argsHas: []string{"--make-shared", "--bind", "/dev/myvg/data-1", mountPath}},
+		},
+	}
+
+	d := blockFilesystemDriver{}
+	if err := d.Mount(context.Background(), runner, "/dev/myvg/data-1", mountPath); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBlockFilesystemDriverGetFSInfoReturnsVolumeSize(t *testing.T) {
+	volume := newTestLVMVolume("data-1", "1073741824B")
+	volume.fsDriver = blockFilesystemDriver{}
+
+	d := blockFilesystemDriver{}
+	info, err := d.GetFSInfo(volume)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.BytesAvailable != 1073741824 || info.BytesCapacity != 1073741824 {
+		t.Errorf("unexpected FSInfo: %+v", info)
+	}
+}
+
+func TestFilesystemDriverForName(t *testing.T) {
+	cases := []struct {
+		name     string
+		wantName string
+		wantErr  bool
+	}{
+		{name: "", wantName: "ext4"},
+		{name: "ext4", wantName: "ext4"},
+		{name: "xfs", wantName: "xfs"},
+		{name: "block", wantName: "block"},
+		{name: "zfs", wantErr: true},
+	}
+
+	for _, c := range cases {
+		d, err := filesystemDriverForName(c.name)
+		if (err != nil) != c.wantErr {
+			t.Errorf("filesystemDriverForName(%q) error = %v, wantErr %v", c.name, err, c.wantErr)
+			continue
+		}
+		if err == nil && d.Name() != c.wantName {
+			t.Errorf("filesystemDriverForName(%q) = %q, want %q", c.name, d.Name(), c.wantName)
+		}
+	}
+}
+
+func TestFilesystemDriverForVolume(t *testing.T) {
+	info := &reportLV{LogicalVolumeTags: "fs=xfs,created=1700000000"}
+	d, err := filesystemDriverForVolume(info)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Name() != "xfs" {
+		t.Errorf("expected xfs driver, got %q", d.Name())
+	}
+}
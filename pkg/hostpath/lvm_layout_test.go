@@ -0,0 +1,159 @@
+package hostpath
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPvCount(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{
+				name:    "pvs",
+				argsHas: []string{"--reportformat=json"},
+				stdout: `{"report":[{"pv":[
+					{"pv_name":"/dev/sda","vg_name":"myvg"},
+					{"pv_name":"/dev/sdb","vg_name":"myvg"},
+					{"pv_name":"/dev/sdc","vg_name":"othervg"}
+				]}]}`,
+			},
+		},
+	}
+	l := &LVM{vg: "myvg", thinpool: "pool", runner: runner}
+
+	count, err := l.pvCount(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 PVs in myvg, got %d", count)
+	}
+}
+
+func TestValidateLayoutRejectsTooManyStripes(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{
+				name:    "pvs",
+				argsHas: []string{"--reportformat=json"},
+				stdout:  `{"report":[{"pv":[{"pv_name":"/dev/sda","vg_name":"myvg"}]}]}`,
+			},
+		},
+	}
+	l := &LVM{vg: "myvg", thinpool: "pool", runner: runner}
+
+	err := l.validateLayout(context.Background(), LVLayout{Stripes: 3})
+	if err == nil {
+		t.Fatalf("expected error when requesting more stripes than PVs, got nil")
+	}
+}
+
+func TestValidateLayoutAcceptsSingleStripe(t *testing.T) {
+	// Stripes <= 1 should not even query pvs.
+	runner := &fakeRunner{t: t}
+	l := &LVM{vg: "myvg", thinpool: "pool", runner: runner}
+
+	if err := l.validateLayout(context.Background(), LVLayout{Stripes: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCreateLVPassesStripeAndMirrorFlags(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{
+				name:    "pvs",
+				argsHas: []string{"--reportformat=json"},
+				stdout: `{"report":[{"pv":[
+					{"pv_name":"/dev/sda","vg_name":"myvg"},
+					{"pv_name":"/dev/sdb","vg_name":"myvg"}
+				]}]}`,
+			},
+			{
+				name: "lvcreate",
+				argsHas: []string{
+					"-L", "10Gi", "--name", "data-1", "--addtag", "fs=ext4",
+					"--stripes", "2", "--stripesize", "64k",
+					"--mirrors", "1", "--mirrorlog", "mirrored",
+					"--addtag", "stripes=2", "--addtag", "stripesize=64k", "--addtag", "mirrors=1",
+					"myvg",
+				},
+			},
+			{name: "mkfs.ext4", argsHas: []string{"/dev/myvg/data-1"}},
+			{
+				name:    "lvs",
+				argsHas: []string{"myvg/data-1"},
+				stdout:  `{"report":[{"lv":[{"lv_name":"data-1","lv_size":"10737418240B","lv_tags":"fs=ext4,stripes=2,stripesize=64k,mirrors=1","origin":"","data_percent":""}]}]}`,
+			},
+			{name: "mount", argsHas: []string{"/dev/myvg/data-1"}},
+		},
+	}
+	l := &LVM{vg: "myvg", thinpool: "pool", runner: runner}
+
+	layout := LVLayout{Stripes: 2, StripeSize: "64k", Mirrors: 1}
+	vol, err := l.createLV(context.Background(), "data-1", "10Gi", "ext4", layout, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if vol.Stripes() != 2 {
+		t.Errorf("expected Stripes() == 2, got %d", vol.Stripes())
+	}
+	if vol.Mirrors() != 1 {
+		t.Errorf("expected Mirrors() == 1, got %d", vol.Mirrors())
+	}
+}
+
+// argvCapturingRunner wraps a CommandRunner and records the args passed for
+// each distinct command name, so a test can assert on exactly what was (or
+// wasn't) sent to lvcreate.
+type argvCapturingRunner struct {
+	inner    CommandRunner
+	captured map[string][]string
+}
+
+func (r *argvCapturingRunner) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	if r.captured == nil {
+		r.captured = map[string][]string{}
+	}
+	r.captured[name] = args
+	return r.inner.Run(ctx, name, args...)
+}
+
+func TestCreateThinLVDoesNotPassMirrorFlags(t *testing.T) {
+	fake := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{
+				name: "lvcreate",
+				argsHas: []string{
+					"--virtualsize", "10Gi", "--thinpool", "pool", "myvg",
+					"--thin", "--type", "thin", "--name", "data-1", "--addtag", "fs=ext4",
+				},
+			},
+			{name: "mkfs.ext4", argsHas: []string{"/dev/myvg/data-1"}},
+			{
+				name:    "lvs",
+				argsHas: []string{"myvg/data-1"},
+				stdout:  `{"report":[{"lv":[{"lv_name":"data-1","lv_size":"10737418240B","lv_tags":"fs=ext4","origin":"","data_percent":""}]}]}`,
+			},
+			{name: "mount", argsHas: []string{"/dev/myvg/data-1"}},
+		},
+	}
+	runner := &argvCapturingRunner{inner: fake}
+	l := &LVM{vg: "myvg", thinpool: "pool", runner: runner}
+
+	// Mirrors set even though this is a thin LV: createThinLV must ignore it.
+	layout := LVLayout{Mirrors: 2}
+	if _, err := l.createThinLV(context.Background(), "data-1", "10Gi", "ext4", layout, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, arg := range runner.captured["lvcreate"] {
+		if arg == "--mirrors" {
+			t.Fatalf("createThinLV must not pass --mirrors, got args: %v", runner.captured["lvcreate"])
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package hostpath
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCreateSnapshot(t *testing.T) {
+	source := newTestLVMVolume("data-1", "1073741824B")
+
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{
+				name:    "lvcreate",
+				argsHas: []string{"--snapshot", "--name", "snap-1", "myvg/data-1", "--addtag", "created=1700000000"},
+			},
+			{
+				name:    "lvs",
+				argsHas: []string{"myvg/snap-1"},
+				stdout:  `{"report":[{"lv":[{"lv_name":"snap-1","lv_size":"1073741824B","lv_tags":"fs=ext4,created=1700000000","origin":"data-1","data_percent":"5"}]}]}`,
+			},
+		},
+	}
+	l := &LVM{vg: "myvg", thinpool: "pool", runner: runner}
+
+	snap, err := l.createSnapshot(context.Background(), source, "snap-1", []string{"created=1700000000"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snap.LogicalVolumeName() != "snap-1" {
+		t.Errorf("unexpected snapshot lv name: %q", snap.LogicalVolumeName())
+	}
+	src, ok := snap.SourceVolumeName()
+	if !ok || src != "data-1" {
+		t.Errorf("expected SourceVolumeName() = (data-1, true), got (%q, %v)", src, ok)
+	}
+	created, ok := snap.CreationTime()
+	if !ok || created != 1700000000 {
+		t.Errorf("expected CreationTime() = (1700000000, true), got (%d, %v)", created, ok)
+	}
+}
+
+func TestDeleteSnapshotDoesNotUnmount(t *testing.T) {
+	snapshot := newTestLVMVolume("snap-1", "1073741824B")
+
+	// Registering only lvremove (no umount call): deleteSnapshot must not
+	// try to unmount a snapshot, since snapshots are never mounted.
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{name: "lvremove", argsHas: []string{"--yes", "myvg/snap-1"}},
+		},
+	}
+	l := &LVM{vg: "myvg", thinpool: "pool", runner: runner}
+
+	if err := l.deleteSnapshot(context.Background(), snapshot); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestListSnapshotsFiltersByOrigin(t *testing.T) {
+	stdout := `{"report":[{"lv":[
+		{"lv_name":"data-1","lv_size":"1073741824B","lv_tags":"fs=ext4","origin":"","data_percent":""},
+		{"lv_name":"snap-of-data-1","lv_size":"1073741824B","lv_tags":"fs=ext4","origin":"data-1","data_percent":"10"},
+		{"lv_name":"snap-of-data-2","lv_size":"1073741824B","lv_tags":"fs=ext4","origin":"data-2","data_percent":"20"}
+	]}]}`
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{name: "lvs", argsHas: []string{"myvg"}, stdout: stdout},
+		},
+	}
+	l := &LVM{vg: "myvg", thinpool: "pool", runner: runner}
+
+	snaps, err := l.listSnapshots(context.Background(), "data-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(snaps) != 1 {
+		t.Fatalf("expected 1 snapshot of data-1, got %d", len(snaps))
+	}
+	if snaps[0].LogicalVolumeName() != "snap-of-data-1" {
+		t.Errorf("unexpected snapshot: %q", snaps[0].LogicalVolumeName())
+	}
+}
+
+func TestListSnapshotsAllWhenSourceEmpty(t *testing.T) {
+	stdout := `{"report":[{"lv":[
+		{"lv_name":"data-1","lv_size":"1073741824B","lv_tags":"fs=ext4","origin":"","data_percent":""},
+		{"lv_name":"snap-of-data-1","lv_size":"1073741824B","lv_tags":"fs=ext4","origin":"data-1","data_percent":"10"},
+		{"lv_name":"snap-of-data-2","lv_size":"1073741824B","lv_tags":"fs=ext4","origin":"data-2","data_percent":"20"}
+	]}]}`
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{name: "lvs", argsHas: []string{"myvg"}, stdout: stdout},
+		},
+	}
+	l := &LVM{vg: "myvg", thinpool: "pool", runner: runner}
+
+	snaps, err := l.listSnapshots(context.Background(), "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(snaps) != 2 {
+		t.Fatalf("expected 2 snapshots total, got %d", len(snaps))
+	}
+}
+
+func TestCreateVolumeFromSourceInheritsFilesystemType(t *testing.T) {
+	source := newTestLVMVolume("data-1", "1073741824B")
+	source.info.LogicalVolumeTags = "fs=xfs"
+
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{
+				name:    "lvcreate",
+				argsHas: []string{"--snapshot", "--name", "data-2", "myvg/data-1", "--addtag", "fs=xfs"},
+			},
+			{
+				name:    "lvs",
+				argsHas: []string{"myvg/data-2"},
+				stdout:  `{"report":[{"lv":[{"lv_name":"data-2","lv_size":"1073741824B","lv_tags":"fs=xfs","origin":"data-1","data_percent":""}]}]}`,
+			},
+			{name: "mount", argsHas: []string{"/dev/myvg/data-2"}},
+		},
+	}
+	l := &LVM{vg: "myvg", thinpool: "pool", runner: runner}
+
+	vol, err := l.createVolumeFromSource(context.Background(), source, "data-2", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if vol.LogicalVolumeName() != "data-2" {
+		t.Errorf("unexpected lv name: %q", vol.LogicalVolumeName())
+	}
+}
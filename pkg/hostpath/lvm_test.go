@@ -0,0 +1,218 @@
+package hostpath
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// fakeRunnerCall is one canned response in a fakeRunner, matched against
+// the argv of a Run call in order.
+type fakeRunnerCall struct {
+	name     string
+	argsHas  []string // every one of these must appear somewhere in args
+	stdout   string
+	stderr   string
+	exitCode int
+}
+
+func (c *fakeRunnerCall) matches(name string, args []string) bool {
+	if c.name != name {
+		return false
+	}
+	joined := strings.Join(args, " ")
+	for _, want := range c.argsHas {
+		if !strings.Contains(joined, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// fakeRunner is a CommandRunner that matches on argv patterns and returns
+// canned stdout/stderr/exit codes, so lvm.go's exec-calling functions can
+// be unit tested without a real lvm2/mount/mkfs installation.
+type fakeRunner struct {
+	t     *testing.T
+	calls []fakeRunnerCall
+}
+
+func (f *fakeRunner) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	for i := range f.calls {
+		c := &f.calls[i]
+		if c.matches(name, args) {
+			var err error
+			if c.exitCode != 0 {
+				err = &CommandError{exitCode: c.exitCode}
+			}
+			return []byte(c.stdout), []byte(c.stderr), err
+		}
+	}
+	f.t.Fatalf("unexpected command: %s %v", name, args)
+	return nil, nil, nil
+}
+
+func TestRunLVSReportNotFound(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{
+				name:     "lvs",
+				argsHas:  []string{"myvg/missing-lv"},
+				stderr:   "  Failed to find logical volume \"myvg/missing-lv\"\n",
+				exitCode: 5,
+			},
+		},
+	}
+
+	report, err := runLVSReport(context.Background(), runner, "myvg/missing-lv")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report.LogicalVolumes) != 0 {
+		t.Fatalf("expected empty report for missing lv, got %+v", report)
+	}
+}
+
+func TestRunLVSReportOtherExitCodeIsError(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{
+				name:     "lvs",
+				argsHas:  []string{"myvg/some-lv"},
+				stderr:   "  some other lvm error\n",
+				exitCode: 1,
+			},
+		},
+	}
+
+	if _, err := runLVSReport(context.Background(), runner, "myvg/some-lv"); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+}
+
+func TestRunLVSReportSingleLV(t *testing.T) {
+	stdout := `{
+  "report": [
+    {
+      "lv": [
+        {"lv_name":"data-1", "lv_size":"1073741824B", "lv_tags":"fs=ext4,created=1700000000", "origin":"", "data_percent":""}
+      ]
+    }
+  ]
+}`
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{name: "lvs", argsHas: []string{"myvg/data-1"}, stdout: stdout},
+		},
+	}
+
+	report, err := runLVSReport(context.Background(), runner, "myvg/data-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report.LogicalVolumes) != 1 {
+		t.Fatalf("expected 1 lv, got %d", len(report.LogicalVolumes))
+	}
+	lv := report.LogicalVolumes[0]
+	if lv.LogicalVolumeName != "data-1" {
+		t.Errorf("unexpected lv_name: %q", lv.LogicalVolumeName)
+	}
+	if lv.IsSnapshot() {
+		t.Errorf("expected data-1 to not be a snapshot")
+	}
+}
+
+func TestRunLVSReportMultiReportIsError(t *testing.T) {
+	stdout := `{
+  "report": [
+    {"lv": [{"lv_name": "a"}]},
+    {"lv": [{"lv_name": "b"}]}
+  ]
+}`
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{name: "lvs", argsHas: []string{"myvg"}, stdout: stdout},
+		},
+	}
+
+	if _, err := runLVSReport(context.Background(), runner, "myvg"); err == nil {
+		t.Fatalf("expected error for multiple reports, got nil")
+	}
+}
+
+func TestRunLVSReportEmptyReportIsError(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{name: "lvs", argsHas: []string{"myvg"}, stdout: `{"report": []}`},
+		},
+	}
+
+	if _, err := runLVSReport(context.Background(), runner, "myvg"); err == nil {
+		t.Fatalf("expected error for empty report, got nil")
+	}
+}
+
+func TestRunMountAlreadyMounted(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{
+				name:     "mount",
+				argsHas:  []string{"/volumes/myvg/data-1"},
+				stderr:   "mount: /volumes/myvg/data-1: /dev/myvg/data-1 already mounted on /volumes/myvg/data-1.\n",
+				exitCode: 32,
+			},
+		},
+	}
+
+	err := runMount(context.Background(), runner, []string{"-t", "ext4", "/dev/myvg/data-1", "/volumes/myvg/data-1"})
+	if err != nil {
+		t.Fatalf("expected already-mounted to be tolerated, got error: %v", err)
+	}
+}
+
+func TestRunMountExitCode32WithoutAlreadyMountedIsError(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{
+				name:     "mount",
+				argsHas:  []string{"/volumes/myvg/data-1"},
+				stderr:   "mount: special device /dev/myvg/data-1 does not exist\n",
+				exitCode: 32,
+			},
+		},
+	}
+
+	err := runMount(context.Background(), runner, []string{"-t", "ext4", "/dev/myvg/data-1", "/volumes/myvg/data-1"})
+	if err == nil {
+		t.Fatalf("expected error for exit code 32 without 'already mounted on' in stderr, got nil")
+	}
+}
+
+func TestFindTag(t *testing.T) {
+	cases := []struct {
+		tags   string
+		key    string
+		want   string
+		wantOk bool
+	}{
+		{tags: "fs=ext4,created=1700000000", key: "fs", want: "ext4", wantOk: true},
+		{tags: "fs=ext4,created=1700000000", key: "created", want: "1700000000", wantOk: true},
+		{tags: "fs=ext4,created=1700000000", key: "missing", want: "", wantOk: false},
+		{tags: "", key: "fs", want: "", wantOk: false},
+	}
+
+	for _, c := range cases {
+		lv := &reportLV{LogicalVolumeTags: c.tags}
+		got, ok := lv.FindTag(c.key)
+		if got != c.want || ok != c.wantOk {
+			t.Errorf("FindTag(%q, %q) = (%q, %v), want (%q, %v)", c.tags, c.key, got, ok, c.want, c.wantOk)
+		}
+	}
+}
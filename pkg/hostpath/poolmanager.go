@@ -0,0 +1,243 @@
+package hostpath
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"context"
+)
+
+// PoolManagerConfig configures the direct-LVM bootstrap performed by
+// PoolManager.EnsurePool. The field names mirror Docker's
+// dm.directlvm_device / dm.thinp_percent / dm.thinp_metapercent /
+// dm.thinp_autoextend_percent / dm.thinp_autoextend_threshold storage
+// driver options, since operators configuring this are likely to already
+// know them from there.
+type PoolManagerConfig struct {
+	// Device is the raw block device to turn into the VG's only PV, e.g.
+	// /dev/sdb. It must not already be partitioned or in use.
+	Device string
+	// VG is the volume group to create (or reuse) on Device.
+	VG string
+	// ThinPool is the thin pool LV to create (or reuse) inside VG.
+	ThinPool string
+	// ThinPoolPercent is the percentage of VG capacity given to the thin
+	// pool's data, e.g. 95.
+	ThinPoolPercent int
+	// ThinPoolMetaPercent is the percentage of VG capacity given to the
+	// thin pool's metadata, e.g. 1.
+	ThinPoolMetaPercent int
+	// AutoextendPercent is thin_pool_autoextend_percent: how much to grow
+	// the pool by each time the threshold below is crossed.
+	AutoextendPercent int
+	// AutoextendThreshold is thin_pool_autoextend_threshold: the
+	// percent-full mark that triggers an autoextend.
+	AutoextendThreshold int
+}
+
+// PoolManager bootstraps a VG and thin pool from a raw block device, so
+// that the driver can start from a blank disk without an operator having
+// to pre-provision LVM by hand.
+type PoolManager struct {
+	config PoolManagerConfig
+	runner CommandRunner
+}
+
+func NewPoolManager(config PoolManagerConfig) *PoolManager {
+	return &PoolManager{
+		config: config,
+		runner: realRunner{},
+	}
+}
+
+func (c *PoolManagerConfig) validate() error {
+	if c.Device == "" {
+		return fmt.Errorf("device is required")
+	}
+	if c.VG == "" {
+		return fmt.Errorf("vg is required")
+	}
+	if c.ThinPool == "" {
+		return fmt.Errorf("thinpool is required")
+	}
+	if c.ThinPoolPercent <= 0 || c.ThinPoolMetaPercent <= 0 {
+		return fmt.Errorf("thinp_percent and thinp_metapercent must both be set")
+	}
+	if c.ThinPoolPercent+c.ThinPoolMetaPercent > 100 {
+		return fmt.Errorf("thinp_percent (%d) + thinp_metapercent (%d) must not exceed 100", c.ThinPoolPercent, c.ThinPoolMetaPercent)
+	}
+	if (c.AutoextendPercent == 0) != (c.AutoextendThreshold == 0) {
+		return fmt.Errorf("thinp_autoextend_percent and thinp_autoextend_threshold must be set together")
+	}
+	if c.AutoextendThreshold < 0 || c.AutoextendThreshold > 100 {
+		return fmt.Errorf("thinp_autoextend_threshold (%d) must be between 0 and 100", c.AutoextendThreshold)
+	}
+	return nil
+}
+
+// EnsurePool creates the VG and thin pool configured in PoolManagerConfig
+// if they do not already exist. It is idempotent: if the VG is already
+// present, it assumes a previous run (or a pre-provisioned operator setup)
+// already did the work and returns without error.
+func (p *PoolManager) EnsurePool(ctx context.Context) error {
+	exists, err := vgExists(ctx, p.runner, p.config.VG)
+	if err != nil {
+		return fmt.Errorf("error checking for volume group %q: %w", p.config.VG, err)
+	}
+	if exists {
+		return nil
+	}
+
+	if err := p.config.validate(); err != nil {
+		return fmt.Errorf("invalid direct-LVM pool configuration: %w", err)
+	}
+
+	if err := pvcreate(ctx, p.runner, p.config.Device); err != nil {
+		return fmt.Errorf("error creating physical volume on %q: %w", p.config.Device, err)
+	}
+
+	if err := vgcreate(ctx, p.runner, p.config.VG, p.config.Device); err != nil {
+		return fmt.Errorf("error creating volume group %q: %w", p.config.VG, err)
+	}
+
+	if err := createThinPool(ctx, p.runner, p.config); err != nil {
+		return fmt.Errorf("error creating thin pool %s/%s: %w", p.config.VG, p.config.ThinPool, err)
+	}
+
+	if p.config.AutoextendPercent != 0 {
+		if err := writeAutoextendProfile(ctx, p.runner, p.config); err != nil {
+			return fmt.Errorf("error writing autoextend profile for %s/%s: %w", p.config.VG, p.config.ThinPool, err)
+		}
+	}
+
+	return nil
+}
+
+func vgExists(ctx context.Context, runner CommandRunner, vg string) (bool, error) {
+	args := []string{vg}
+	stdout, stderr, err := runner.Run(ctx, "vgs", args...)
+	if err != nil {
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) && cmdErr.ExitCode() == 5 {
+			return false, nil
+		}
+		return false, commandErrorString("vgs", args, stdout, stderr, err)
+	}
+
+	return true, nil
+}
+
+func pvcreate(ctx context.Context, runner CommandRunner, device string) error {
+	args := []string{"--metadatasize=128M", "--zero=y", device}
+	stdout, stderr, err := runner.Run(ctx, "pvcreate", args...)
+	if err != nil {
+		return commandErrorString("pvcreate", args, stdout, stderr, err)
+	}
+
+	return nil
+}
+
+func vgcreate(ctx context.Context, runner CommandRunner, vg string, device string) error {
+	args := []string{vg, device}
+	stdout, stderr, err := runner.Run(ctx, "vgcreate", args...)
+	if err != nil {
+		return commandErrorString("vgcreate", args, stdout, stderr, err)
+	}
+
+	return nil
+}
+
+// vgSizeBytes returns the total capacity of vg, in bytes.
+func vgSizeBytes(ctx context.Context, runner CommandRunner, vg string) (int64, error) {
+	args := []string{"--reportformat=json", "--units=b", "--options=vg_size", vg}
+	stdout, stderr, err := runner.Run(ctx, "vgs", args...)
+	if err != nil {
+		return 0, commandErrorString("vgs", args, stdout, stderr, err)
+	}
+
+	r := &struct {
+		Reports []struct {
+			VolumeGroups []struct {
+				VolumeGroupSize string `json:"vg_size"`
+			} `json:"vg"`
+		} `json:"report"`
+	}{}
+	if err := json.Unmarshal(stdout, r); err != nil {
+		return 0, fmt.Errorf("error parsing output from command [vgs %s] (stdout=%q, stderr=%q): %w", strings.Join(args, " "), string(stdout), string(stderr), err)
+	}
+	if len(r.Reports) != 1 || len(r.Reports[0].VolumeGroups) != 1 {
+		return 0, fmt.Errorf("unexpected output from command [vgs %s] (stdout=%q)", strings.Join(args, " "), string(stdout))
+	}
+
+	sizeStr := strings.TrimSuffix(strings.TrimSuffix(r.Reports[0].VolumeGroups[0].VolumeGroupSize, "B"), "b")
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing vg_size %q: %w", r.Reports[0].VolumeGroups[0].VolumeGroupSize, err)
+	}
+	return size, nil
+}
+
+// createThinPool creates the thin pool LV, sized as ThinPoolPercent of the
+// VG. --poolmetadatasize takes an absolute Size[UNIT], unlike -l/--extents,
+// so the metadata size is computed here from ThinPoolMetaPercent of the
+// VG's total capacity rather than passed through as a percentage.
+func createThinPool(ctx context.Context, runner CommandRunner, config PoolManagerConfig) error {
+	vgSize, err := vgSizeBytes(ctx, runner, config.VG)
+	if err != nil {
+		return fmt.Errorf("error getting size of volume group %q: %w", config.VG, err)
+	}
+	metaSizeMiB := vgSize * int64(config.ThinPoolMetaPercent) / 100 / (1024 * 1024)
+	if metaSizeMiB < 1 {
+		metaSizeMiB = 1
+	}
+
+	args := []string{
+		"--thinpool", config.ThinPool,
+		"-l", fmt.Sprintf("%d%%VG", config.ThinPoolPercent),
+		"--poolmetadatasize", fmt.Sprintf("%dM", metaSizeMiB),
+		config.VG,
+	}
+	stdout, stderr, err := runner.Run(ctx, "lvcreate", args...)
+	if err != nil {
+		return commandErrorString("lvcreate", args, stdout, stderr, err)
+	}
+
+	return nil
+}
+
+// writeAutoextendProfile writes an LVM profile that turns on automatic
+// thin pool extension, and assigns it to the pool via lvchange. lvm2 only
+// picks up activation/thin_pool_autoextend_* from a profile, not from the
+// command line.
+func writeAutoextendProfile(ctx context.Context, runner CommandRunner, config PoolManagerConfig) error {
+	profileDir := "/etc/lvm/profile"
+	if err := os.MkdirAll(profileDir, 0755); err != nil {
+		return fmt.Errorf("error creating profile directory %q: %w", profileDir, err)
+	}
+
+	profileName := fmt.Sprintf("%s-%s", config.VG, config.ThinPool)
+	profilePath := filepath.Join(profileDir, profileName+".profile")
+
+	contents := fmt.Sprintf(`activation {
+	thin_pool_autoextend_threshold = %d
+	thin_pool_autoextend_percent = %d
+}
+`, config.AutoextendThreshold, config.AutoextendPercent)
+
+	if err := os.WriteFile(profilePath, []byte(contents), 0644); err != nil {
+		return fmt.Errorf("error writing profile %q: %w", profilePath, err)
+	}
+
+	args := []string{"--metadataprofile", profileName, config.VG + "/" + config.ThinPool}
+	stdout, stderr, err := runner.Run(ctx, "lvchange", args...)
+	if err != nil {
+		return commandErrorString("lvchange", args, stdout, stderr, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package hostpath
+
+import (
+	"context"
+	"testing"
+)
+
+func TestVGExistsNotFound(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{
+				name:     "vgs",
+				argsHas:  []string{"myvg"},
+				stderr:   "  Volume group \"myvg\" not found\n",
+				exitCode: 5,
+			},
+		},
+	}
+
+	exists, err := vgExists(context.Background(), runner, "myvg")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exists {
+		t.Fatalf("expected vgExists to return false for a missing VG")
+	}
+}
+
+func TestVGExistsFound(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{name: "vgs", argsHas: []string{"myvg"}, stdout: "  myvg\n"},
+		},
+	}
+
+	exists, err := vgExists(context.Background(), runner, "myvg")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !exists {
+		t.Fatalf("expected vgExists to return true for an existing VG")
+	}
+}
+
+func TestVGExistsOtherExitCodeIsError(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{name: "vgs", argsHas: []string{"myvg"}, stderr: "some other lvm error\n", exitCode: 1},
+		},
+	}
+
+	if _, err := vgExists(context.Background(), runner, "myvg"); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+}
+
+func TestVGSizeBytes(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{
+				name:    "vgs",
+				argsHas: []string{"--reportformat=json", "myvg"},
+				stdout:  `{"report":[{"vg":[{"vg_size":"10737418240B"}]}]}`,
+			},
+		},
+	}
+
+	size, err := vgSizeBytes(context.Background(), runner, "myvg")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if size != 10737418240 {
+		t.Errorf("unexpected vg size: %d", size)
+	}
+}
+
+func TestCreateThinPoolPassesAbsoluteMetadataSize(t *testing.T) {
+	runner := &fakeRunner{
+		t: t,
+		calls: []fakeRunnerCall{
+			{
+				name:    "vgs",
+				argsHas: []string{"--reportformat=json", "myvg"},
+				stdout:  `{"report":[{"vg":[{"vg_size":"10737418240B"}]}]}`,
+			},
+			{
+				name:    "lvcreate",
+				argsHas: []string{"--thinpool", "thinpool", "-l", "95%VG", "--poolmetadatasize", "102M", "myvg"},
+			},
+		},
+	}
+
+	config := PoolManagerConfig{VG: "myvg", ThinPool: "thinpool", ThinPoolPercent: 95, ThinPoolMetaPercent: 1}
+	if err := createThinPool(context.Background(), runner, config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPoolManagerConfigValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  PoolManagerConfig
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			config: PoolManagerConfig{
+				Device: "/dev/sdb", VG: "vg", ThinPool: "thinpool",
+				ThinPoolPercent: 95, ThinPoolMetaPercent: 1,
+			},
+		},
+		{
+			name: "percentages exceed 100",
+			config: PoolManagerConfig{
+				Device: "/dev/sdb", VG: "vg", ThinPool: "thinpool",
+				ThinPoolPercent: 99, ThinPoolMetaPercent: 5,
+			},
+			wantErr: true,
+		},
+		{
+			name: "autoextend threshold without percent",
+			config: PoolManagerConfig{
+				Device: "/dev/sdb", VG: "vg", ThinPool: "thinpool",
+				ThinPoolPercent: 95, ThinPoolMetaPercent: 1,
+				AutoextendThreshold: 80,
+			},
+			wantErr: true,
+		},
+		{
+			name:    "missing device",
+			config:  PoolManagerConfig{VG: "vg", ThinPool: "thinpool", ThinPoolPercent: 95, ThinPoolMetaPercent: 1},
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		err := c.config.validate()
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: validate() error = %v, wantErr %v", c.name, err, c.wantErr)
+		}
+	}
+}